@@ -0,0 +1,70 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: BUSL-1.1
+
+package configs
+
+import (
+	version "github.com/hashicorp/go-version"
+	"github.com/hashicorp/hcl/v2"
+
+	"github.com/hashicorp/terraform/internal/addrs"
+)
+
+// Config is a node in the tree of modules that make up a configuration,
+// as constructed by BuildConfig by loading a root Module and all of its
+// descendent modules.
+type Config struct {
+	// Parent is the Config for the module that called this one via a
+	// "module" block, or nil for the root module.
+	Parent *Config
+
+	// Root is the Config for the root module of this tree. The root
+	// module's own Root field points back to itself.
+	Root *Config
+
+	// Path is the sequence of module call names leading from the root
+	// module down to this one.
+	Path addrs.Module
+
+	// Module is the parsed configuration content of this module.
+	Module *Module
+
+	// Children maps the local name of each direct child module call to the
+	// Config for that child.
+	Children map[string]*Config
+
+	// CallRange is the source range of the "module" block that this module
+	// was loaded from, or the zero value for the root module.
+	CallRange hcl.Range
+
+	// SourceAddr is the source address this module was loaded from, as
+	// given by the calling module's "module" block, or nil for the root
+	// module.
+	SourceAddr addrs.ModuleSource
+
+	// SourceAddrRange is the source range of SourceAddr as written in
+	// configuration.
+	SourceAddrRange hcl.Range
+
+	// Version is the version of this module that was selected, for modules
+	// whose SourceAddr refers to a registry module under a version
+	// constraint. It's nil for modules that aren't versioned this way.
+	Version *version.Version
+
+	// Deprecation holds the deprecation info loadModule returned for this
+	// module, with ExternalDependencies holding that of its children. For a
+	// module whose source isn't a registry address it's always non-nil,
+	// with a nil RegistryDeprecation; for a registry module it's whatever
+	// the ModuleWalker returned, which may be nil. It's nil for the root
+	// module. It's consumed by CollectDeprecations, which reports only
+	// entries with a non-nil RegistryDeprecation.
+	Deprecation *ModuleDeprecationInfo
+
+	// canonicalSourceKey is a resolved identity for SourceAddr, used by
+	// detectModuleSelfReference to recognize a module calling back into
+	// one of its own ancestors even when the source address is written
+	// as a local path that's only meaningful relative to the calling
+	// module's directory. It's set alongside SourceAddr as each Config
+	// is constructed.
+	canonicalSourceKey string
+}
@@ -5,37 +5,91 @@ package configs
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"path"
 	"sort"
 	"strings"
+	"sync"
 
 	version "github.com/hashicorp/go-version"
 	"github.com/hashicorp/hcl/v2"
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/sync/singleflight"
 
 	"github.com/hashicorp/terraform/internal/addrs"
 )
 
+// BuildConfigOptions customizes the behavior of BuildConfig. A nil
+// *BuildConfigOptions (or a zero-value one) selects fully sequential,
+// backward-compatible behavior.
+type BuildConfigOptions struct {
+	// Concurrency is the maximum number of sibling child modules of any one
+	// module (or test runs of the root module) that may be loaded
+	// concurrently via the given ModuleWalker. The limit applies separately
+	// to each module's own children, so loads under different parent
+	// modules can add up to more than this. Values less than two disable
+	// concurrency and
+	// cause BuildConfig to walk the module tree sequentially, which is the
+	// default when no options are given.
+	Concurrency int
+
+	// AllowVersionedModuleCycles, when true, relaxes the module
+	// self-reference check so that a registry module is allowed to appear
+	// again among its own ancestors as long as the two occurrences resolve
+	// to different versions. This is legitimate: module B v2.0.0 calling
+	// module B v1.0.0 is not a cycle in the sense that matters (infinite
+	// recursion), since the two calls load distinct, independently
+	// versioned content. When false (the default), any repeated source
+	// address in the ancestor chain is treated as a self-reference error,
+	// regardless of version.
+	AllowVersionedModuleCycles bool
+}
+
+// concurrency returns the effective, normalized concurrency for these
+// options, treating a nil receiver the same as sequential (1).
+func (o *BuildConfigOptions) concurrency() int {
+	if o == nil || o.Concurrency < 1 {
+		return 1
+	}
+	return o.Concurrency
+}
+
 // BuildConfig constructs a Config from a root module by loading all of its
 // descendent modules via the given ModuleWalker. This function also side loads
 // and installs any mock data files needed by the testing framework via the
 // MockDataLoader.
 //
+// opts is variadic so that existing callers may go on omitting it entirely;
+// only the first value, if any, is used, and a nil or absent value selects
+// the default, sequential module walk. Passing a *BuildConfigOptions with
+// Concurrency greater than one allows sibling modules to be loaded
+// concurrently; see the ModuleWalker documentation for the concurrency
+// guarantees this requires of implementations.
+//
 // The result is a module tree that has so far only had basic module- and
 // file-level invariants validated. If the returned diagnostics contains errors,
 // the returned module tree may be incomplete but can still be used carefully
 // for static analysis.
-func BuildConfig(ctx context.Context, root *Module, walker ModuleWalker, loader MockDataLoader) (*Config, hcl.Diagnostics, []*ModuleDeprecationInfo) {
+func BuildConfig(ctx context.Context, root *Module, walker ModuleWalker, loader MockDataLoader, opts ...*BuildConfigOptions) (*Config, hcl.Diagnostics, []*ModuleDeprecationInfo) {
 	ctx, span := tracer.Start(ctx, "build config")
 	defer span.End()
+	var opt *BuildConfigOptions
+	if len(opts) > 0 {
+		opt = opts[0]
+	}
 	var diags hcl.Diagnostics
 	var modDeprecations []*ModuleDeprecationInfo
 	cfg := &Config{
 		Module: root,
 	}
 	cfg.Root = cfg // Root module is self-referential.
-	cfg.Children, diags, modDeprecations = buildChildModules(ctx, cfg, walker)
-	diags = append(diags, buildTestModules(ctx, cfg, walker)...)
+	// The root module has no SourceAddr of its own, but it still needs a
+	// canonicalSourceKey so that detectModuleSelfReference can recognize a
+	// descendant module calling back into the root, e.g. via "../..".
+	cfg.canonicalSourceKey = "dir:" + path.Clean(root.SourceDir)
+	cfg.Children, diags, modDeprecations = buildChildModules(ctx, cfg, walker, opt)
+	diags = append(diags, buildTestModules(ctx, cfg, walker, opt)...)
 
 	// Skip provider resolution if there are any errors, since the provider
 	// configurations themselves may not be valid.
@@ -79,9 +133,13 @@ func installMockDataFiles(root *Config, loader MockDataLoader) hcl.Diagnostics {
 	return diags
 }
 
-func buildTestModules(ctx context.Context, root *Config, walker ModuleWalker) hcl.Diagnostics {
-	var diags hcl.Diagnostics
+func buildTestModules(ctx context.Context, root *Config, walker ModuleWalker, opts *BuildConfigOptions) hcl.Diagnostics {
+	type testModuleLoad struct {
+		run *TestRun
+		req ModuleRequest
+	}
 
+	var loads []testModuleLoad
 	for name, file := range root.Module.Tests {
 		for _, run := range file.Runs {
 			if run.Module == nil {
@@ -105,21 +163,114 @@ func buildTestModules(ctx context.Context, root *Config, walker ModuleWalker) hc
 			}
 			path = append(path, strings.TrimSuffix(base, ".tftest.hcl"), run.Name)
 
-			req := ModuleRequest{
-				Name:              run.Name,
-				Path:              path,
-				SourceAddr:        run.Module.Source,
-				SourceAddrRange:   run.Module.SourceDeclRange,
-				VersionConstraint: run.Module.Version,
-				Parent:            root,
-				CallRange:         run.Module.DeclRange,
-			}
+			loads = append(loads, testModuleLoad{
+				run: run,
+				req: ModuleRequest{
+					Name:              run.Name,
+					Path:              path,
+					SourceAddr:        run.Module.Source,
+					SourceAddrRange:   run.Module.SourceDeclRange,
+					VersionConstraint: run.Module.Version,
+					Parent:            root,
+					CallRange:         run.Module.DeclRange,
+				},
+			})
+		}
+	}
 
-			// mdTODO: don't think mod deprecations are relevant here, check!
-			cfg, modDiags, _ := loadModule(ctx, root, &req, walker)
-			diags = append(diags, modDiags...)
+	var diags hcl.Diagnostics
+	diagsPerLoad := make([]hcl.Diagnostics, len(loads))
+
+	// Many runs in the same test suite commonly reuse the same fixture
+	// module (same SourceAddr and VersionConstraint), so we cache the
+	// resulting *Config (and the diagnostics it loaded with) per
+	// BuildConfig call and hand out a deep clone to each run, rather than
+	// paying for loadModule again. Cloning is required because
+	// cfg.Parent/rebaseChildModule below mutate the returned Config in
+	// place, and those mutations must not leak between runs that share a
+	// cache entry. sf dedupes concurrent cache misses for the same key so
+	// that two runs scheduled at the same time don't both pay for
+	// loadModule.
+	var cacheMu sync.Mutex
+	cache := map[string]*Config{}
+	cacheDiags := map[string]hcl.Diagnostics{}
+	var sf singleflight.Group
+
+	type testModuleLoadResult struct {
+		cfg   *Config
+		diags hcl.Diagnostics
+	}
+
+	g, gCtx := errgroup.WithContext(ctx)
+	g.SetLimit(opts.concurrency())
+	for i, load := range loads {
+		i, load := i, load
+		g.Go(func() error {
+			key := testModuleCacheKey(load.req.SourceAddr, load.req.VersionConstraint)
+
+			cacheMu.Lock()
+			cachedCfg, isCached := cache[key]
+			cachedDiags := cacheDiags[key]
+			cacheMu.Unlock()
+
+			var result testModuleLoadResult
+			if isCached {
+				result = testModuleLoadResult{cfg: cachedCfg, diags: cachedDiags}
+			} else {
+				// mdTODO: don't think mod deprecations are relevant here, check!
+				v, _, _ := sf.Do(key, func() (interface{}, error) {
+					// Another run may have filled this entry between the
+					// check above and this call; reuse it if so.
+					cacheMu.Lock()
+					if cachedCfg, ok := cache[key]; ok {
+						cachedDiags := cacheDiags[key]
+						cacheMu.Unlock()
+						return testModuleLoadResult{cfg: cachedCfg, diags: cachedDiags}, nil
+					}
+					cacheMu.Unlock()
+
+					loadedCfg, modDiags, _ := loadModule(gCtx, root, &load.req, walker, opts)
+					if loadedCfg != nil {
+						cacheMu.Lock()
+						cache[key] = loadedCfg
+						cacheDiags[key] = modDiags
+						cacheMu.Unlock()
+					}
+					return testModuleLoadResult{cfg: loadedCfg, diags: modDiags}, nil
+				})
+				result = v.(testModuleLoadResult)
+			}
 
+			cfg := cloneConfig(result.cfg)
+			diags := result.diags
 			if cfg != nil {
+				// Every descendant of this cached Config had its Path
+				// computed relative to whichever run's request first
+				// populated this cache entry, which may sit at a
+				// different path depth than this run's own request (e.g.
+				// one run's "setup" lives in main.tftest.hcl while
+				// another's lives in tests/sub/main.tftest.hcl). Capture
+				// that original length now, before overwriting cfg.Path
+				// below, so each descendant can be rebased by the length
+				// it was actually built against rather than this run's.
+				origRootPathLen := len(cfg.Path)
+
+				// Each run gets its own clone, so restore the fields that
+				// identify this specific module call before handing it
+				// back, in case this clone came from a cache entry first
+				// populated by a different run referencing the same
+				// module source and version.
+				cfg.Path = load.req.Path
+				cfg.CallRange = load.req.CallRange
+				cfg.SourceAddrRange = load.req.SourceAddrRange
+
+				// The cached diags may have been produced against a
+				// different run's Path, and some of them (the import block
+				// check) are formatted from it. Regenerate those against
+				// this run's own corrected Path instead of replaying the
+				// stale text verbatim.
+				diags = withCorrectedImportDiagnostics(diags, cfg.Path, cfg.Module)
+
 				// To get the loader to work, we need to set a bunch of values
 				// (like the name, path, and parent) as if the module was being
 				// loaded as a child of the root config.
@@ -132,69 +283,106 @@ func buildTestModules(ctx context.Context, root *Config, walker ModuleWalker) hc
 				// if it is the root module.
 				cfg.Parent = nil
 
-				// Then we need to update the paths for this config and all
-				// children, so they think they are all relative to the root
-				// module we just created.
-				rebaseChildModule(cfg, cfg)
+				// Then we need to update the paths for every descendant, so
+				// they think they are all relative to the root module we
+				// just created, before making this node itself the new
+				// root with an empty Path.
+				for _, child := range cfg.Children {
+					rebaseChildModule(child, origRootPathLen, cfg)
+				}
+				cfg.Path = addrs.Module{}
+				cfg.Root = cfg
 
 				// Finally, link the new config back into our test run so
 				// it can be retrieved later.
-				run.ConfigUnderTest = cfg
+				load.run.ConfigUnderTest = cfg
 			}
-		}
+			diagsPerLoad[i] = diags
+
+			return nil
+		})
+	}
+	// g.Go never returns a non-nil error above, so this can't fail; we still
+	// call Wait to block for completion of every launched goroutine.
+	g.Wait()
+
+	for _, d := range diagsPerLoad {
+		diags = append(diags, d...)
 	}
 
 	return diags
 }
 
-func buildChildModules(ctx context.Context, parent *Config, walker ModuleWalker) (map[string]*Config, hcl.Diagnostics, []*ModuleDeprecationInfo) {
+func buildChildModules(ctx context.Context, parent *Config, walker ModuleWalker, opts *BuildConfigOptions) (map[string]*Config, hcl.Diagnostics, []*ModuleDeprecationInfo) {
 	ctx, span := tracer.Start(ctx, "build child modules")
 	defer span.End()
-	var diags hcl.Diagnostics
-	modDeprecations := []*ModuleDeprecationInfo{}
 	ret := map[string]*Config{}
 
 	calls := parent.Module.ModuleCalls
 
 	// We'll sort the calls by their local names so that they'll appear in a
-	// predictable order in any logging that's produced during the walk.
+	// predictable order in any logging that's produced during the walk, and
+	// so that the results below can be merged back in a deterministic order
+	// even when they were fetched concurrently.
 	callNames := make([]string, 0, len(calls))
 	for k := range calls {
 		callNames = append(callNames, k)
 	}
 	sort.Strings(callNames)
 
-	for _, callName := range callNames {
-		call := calls[callName]
-		path := make([]string, len(parent.Path)+1)
-		copy(path, parent.Path)
-		path[len(path)-1] = call.Name
-
-		req := ModuleRequest{
-			Name:              call.Name,
-			Path:              path,
-			SourceAddr:        call.SourceAddr,
-			SourceAddrRange:   call.SourceAddrRange,
-			VersionConstraint: call.Version,
-			Parent:            parent,
-			CallRange:         call.DeclRange,
-		}
-		child, modDiags, modDeprecation := loadModule(ctx, parent.Root, &req, walker)
-		diags = append(diags, modDiags...)
-		modDeprecations = append(modDeprecations, modDeprecation)
-		if child == nil {
+	type loadResult struct {
+		child          *Config
+		diags          hcl.Diagnostics
+		modDeprecation *ModuleDeprecationInfo
+	}
+	results := make([]loadResult, len(callNames))
+
+	g, gCtx := errgroup.WithContext(ctx)
+	g.SetLimit(opts.concurrency())
+	for i, callName := range callNames {
+		i, call := i, calls[callName]
+		g.Go(func() error {
+			path := make([]string, len(parent.Path)+1)
+			copy(path, parent.Path)
+			path[len(path)-1] = call.Name
+
+			req := ModuleRequest{
+				Name:              call.Name,
+				Path:              path,
+				SourceAddr:        call.SourceAddr,
+				SourceAddrRange:   call.SourceAddrRange,
+				VersionConstraint: call.Version,
+				Parent:            parent,
+				CallRange:         call.DeclRange,
+			}
+			child, modDiags, modDeprecation := loadModule(gCtx, parent.Root, &req, walker, opts)
+			results[i] = loadResult{child: child, diags: modDiags, modDeprecation: modDeprecation}
+			return nil
+		})
+	}
+	// g.Go never returns a non-nil error above, so this can't fail; we still
+	// call Wait to block for completion of every launched goroutine.
+	g.Wait()
+
+	var diags hcl.Diagnostics
+	modDeprecations := []*ModuleDeprecationInfo{}
+	for i, callName := range callNames {
+		result := results[i]
+		diags = append(diags, result.diags...)
+		modDeprecations = append(modDeprecations, result.modDeprecation)
+		if result.child == nil {
 			// This means an error occurred, there should be diagnostics within
 			// modDiags for this.
 			continue
 		}
 
-		ret[call.Name] = child
+		ret[callName] = result.child
 	}
 
 	return ret, diags, modDeprecations
 }
 
-func loadModule(ctx context.Context, root *Config, req *ModuleRequest, walker ModuleWalker) (*Config, hcl.Diagnostics, *ModuleDeprecationInfo) {
+func loadModule(ctx context.Context, root *Config, req *ModuleRequest, walker ModuleWalker, opts *BuildConfigOptions) (*Config, hcl.Diagnostics, *ModuleDeprecationInfo) {
 	var diags hcl.Diagnostics
 	var modDeprecation *ModuleDeprecationInfo
 	var childModDeprecations []*ModuleDeprecationInfo
@@ -208,18 +396,44 @@ func loadModule(ctx context.Context, root *Config, req *ModuleRequest, walker Mo
 		return nil, diags, nil
 	}
 
+	if modDeprecation != nil && modDeprecation.RegistryDeprecation != nil && modDeprecation.RegistryDeprecation.Subject == nil {
+		// Some ModuleWalker implementations don't have a precise source
+		// range to blame a registry deprecation notice on. Fall back to the
+		// module call's own source address range so that consumers such as
+		// CollectDeprecations always have something to point an editor at.
+		modDeprecation.RegistryDeprecation.Subject = req.SourceAddrRange.Ptr()
+	}
+
+	if req.Parent != nil {
+		if ancestor, isCycle := detectModuleSelfReference(req.Parent, req.SourceAddr); isCycle {
+			_, isRegistryModule := req.SourceAddr.(addrs.ModuleSourceRegistry)
+			versionsDiffer := ancestor.Version != nil && ver != nil && !ancestor.Version.Equal(ver)
+			allowVersionedCycle := opts != nil && opts.AllowVersionedModuleCycles && isRegistryModule && versionsDiffer
+			if !allowVersionedCycle {
+				diags = diags.Append(&hcl.Diagnostic{
+					Severity: hcl.DiagError,
+					Summary:  "Module self-reference detected",
+					Detail:   fmt.Sprintf("This module call creates a self-reference: %s. A module cannot (directly or indirectly) call itself.", moduleSelfReferenceChain(ancestor, req.Parent, req.SourceAddr)),
+					Subject:  req.SourceAddrRange.Ptr(),
+				})
+				return nil, diags, nil
+			}
+		}
+	}
+
 	cfg := &Config{
-		Parent:          req.Parent,
-		Root:            root,
-		Path:            req.Path,
-		Module:          mod,
-		CallRange:       req.CallRange,
-		SourceAddr:      req.SourceAddr,
-		SourceAddrRange: req.SourceAddrRange,
-		Version:         ver,
+		Parent:             req.Parent,
+		Root:               root,
+		Path:               req.Path,
+		Module:             mod,
+		CallRange:          req.CallRange,
+		SourceAddr:         req.SourceAddr,
+		SourceAddrRange:    req.SourceAddrRange,
+		Version:            ver,
+		canonicalSourceKey: moduleSourceKey(req.Parent, req.SourceAddr),
 	}
 
-	cfg.Children, modDiags, childModDeprecations = buildChildModules(ctx, cfg, walker)
+	cfg.Children, modDiags, childModDeprecations = buildChildModules(ctx, cfg, walker, opts)
 	diags = append(diags, modDiags...)
 	// mdTODO: Should we return something from the non registry module install methods? Might be more sensable there rather than here.
 	// if the module is not a registry module we won't have a parent ModuleDeprecationInfo to attach any registry modules it has as external dependencies
@@ -234,6 +448,11 @@ func loadModule(ctx context.Context, root *Config, req *ModuleRequest, walker Mo
 	if modDeprecation != nil && childModDeprecations != nil {
 		modDeprecation.ExternalDependencies = childModDeprecations
 	}
+	// Keep a copy on the Config itself too, so that CollectDeprecations can
+	// later flatten the tree without needing the separate modDeprecations
+	// slice that buildChildModules/BuildConfig thread through their return
+	// values.
+	cfg.Deprecation = modDeprecation
 	if mod.Backend != nil {
 		diags = diags.Append(&hcl.Diagnostic{
 			Severity: hcl.DiagWarning,
@@ -243,20 +462,154 @@ func loadModule(ctx context.Context, root *Config, req *ModuleRequest, walker Mo
 		})
 	}
 
+	diags = append(diags, importBlockDiagnostics(cfg.Path, mod)...)
+
+	return cfg, diags, modDeprecation
+}
+
+// importBlockDiagnostics reports an error for each import block found in mod
+// if modulePath is anything other than the root module path, since import
+// blocks are only allowed there.
+//
+// This is pulled out of loadModule because the diagnostic text is derived
+// from modulePath, which for a cached test-run module (see buildTestModules)
+// can differ between runs sharing the same cached *Config; callers that
+// replay cached diagnostics need to be able to regenerate this one against
+// the current run's own path instead.
+func importBlockDiagnostics(modulePath addrs.Module, mod *Module) hcl.Diagnostics {
+	var diags hcl.Diagnostics
 	if len(mod.Import) > 0 {
 		diags = diags.Append(&hcl.Diagnostic{
 			Severity: hcl.DiagError,
 			Summary:  "Invalid import configuration",
-			Detail:   fmt.Sprintf("An import block was detected in %q. Import blocks are only allowed in the root module.", cfg.Path),
+			Detail:   fmt.Sprintf("An import block was detected in %q. Import blocks are only allowed in the root module.", modulePath),
 			Subject:  mod.Import[0].DeclRange.Ptr(),
 		})
 	}
+	return diags
+}
 
-	return cfg, diags, modDeprecation
+// withCorrectedImportDiagnostics returns diags with any "Invalid import
+// configuration" diagnostic replaced by one freshly generated against
+// modulePath, leaving every other diagnostic untouched.
+//
+// buildTestModules may hand out diags that were cached alongside a *Config
+// loaded for a different run sharing the same module source and version. A
+// plain replay of those diags would misattribute the import-block error's
+// path to whichever run first populated the cache entry, so that one
+// diagnostic needs to be rebuilt per run instead.
+func withCorrectedImportDiagnostics(diags hcl.Diagnostics, modulePath addrs.Module, mod *Module) hcl.Diagnostics {
+	corrected := make(hcl.Diagnostics, 0, len(diags))
+	for _, diag := range diags {
+		if diag.Summary == "Invalid import configuration" {
+			continue
+		}
+		corrected = append(corrected, diag)
+	}
+	return append(corrected, importBlockDiagnostics(modulePath, mod)...)
+}
+
+// moduleSourceKey returns a canonical identity for a module source address
+// as called from caller, suitable for comparing against ancestors'
+// canonicalSourceKey to detect a module self-reference.
+//
+// A registry or other non-local source address is already a stable,
+// absolute identity, so it's keyed by its own String() form. A local source
+// address, by contrast, is only meaningful relative to the directory of the
+// module doing the calling (e.g. "../.." means something different in every
+// module that writes it), so it's resolved against the caller's source
+// directory before being used as a key. Without this resolution, two
+// unrelated modules that both happen to write the same relative path (e.g.
+// every module vendoring a shared helper at "./modules/common") would be
+// mistaken for a self-reference, while an actual cycle through a relative
+// path like "../.." back to the root would never be caught.
+func moduleSourceKey(caller *Config, addr addrs.ModuleSource) string {
+	if local, ok := addr.(addrs.ModuleSourceLocal); ok {
+		return "dir:" + path.Clean(path.Join(caller.Module.SourceDir, string(local)))
+	}
+	return "addr:" + addr.String()
 }
 
-// rebaseChildModule updates cfg to make it act as if root is the base of the
-// module tree.
+// detectModuleSelfReference walks the Parent chain of parent, starting with
+// parent itself, looking for a module whose canonical source key matches
+// candidate's. This is how buildChildModules/loadModule notice a module tree
+// that would otherwise recurse forever, such as a local module calling
+// itself via "../..".
+//
+// If a match is found, the ancestor Config that matched is returned along
+// with true. The root module is a valid match, since its canonicalSourceKey
+// is set from its own source directory rather than left unset.
+func detectModuleSelfReference(parent *Config, candidate addrs.ModuleSource) (*Config, bool) {
+	candidateKey := moduleSourceKey(parent, candidate)
+	for ancestor := parent; ancestor != nil; ancestor = ancestor.Parent {
+		if ancestor.canonicalSourceKey == candidateKey {
+			return ancestor, true
+		}
+	}
+	return nil, false
+}
+
+// moduleSelfReferenceChain renders the chain of source addresses from the
+// detected ancestor down through parent and back to the candidate again, for
+// use in a self-reference diagnostic message, e.g. "a -> b -> a".
+func moduleSelfReferenceChain(ancestor *Config, parent *Config, candidate addrs.ModuleSource) string {
+	var chain []string
+	for cfg := parent; cfg != nil; cfg = cfg.Parent {
+		if cfg.SourceAddr != nil {
+			chain = append(chain, cfg.SourceAddr.String())
+		}
+		if cfg == ancestor {
+			break
+		}
+	}
+	for i, j := 0, len(chain)-1; i < j; i, j = i+1, j-1 {
+		chain[i], chain[j] = chain[j], chain[i]
+	}
+	// The first loop above already walked up through and including
+	// ancestor, so its source address (if any) is already in chain, now as
+	// its first element; only the new candidate address needs to be
+	// appended to close the loop.
+	chain = append(chain, candidate.String())
+	return strings.Join(chain, " -> ")
+}
+
+// testModuleCacheKey returns the cache key buildTestModules uses to reuse a
+// previously-loaded module configuration across multiple run blocks that
+// reference the same module source and version constraint.
+func testModuleCacheKey(addr addrs.ModuleSource, constraint VersionConstraint) string {
+	return addr.String() + "@" + constraint.Required.String()
+}
+
+// cloneConfig returns a deep copy of cfg, including all of its descendent
+// Children, so that a cached *Config can be handed out to multiple test runs
+// without later mutations (cfg.Parent reassignment, rebaseChildModule) on
+// one run's copy leaking into another's.
+func cloneConfig(cfg *Config) *Config {
+	if cfg == nil {
+		return nil
+	}
+
+	clone := *cfg
+	if cfg.Children != nil {
+		clone.Children = make(map[string]*Config, len(cfg.Children))
+		for name, child := range cfg.Children {
+			childClone := cloneConfig(child)
+			childClone.Parent = &clone
+			clone.Children[name] = childClone
+		}
+	}
+	return &clone
+}
+
+// rebaseChildModule updates cfg, a descendant of a module tree whose root is
+// being replaced, to make it act as if root is the new base of that tree.
+//
+// origRootPathLen is the length of the original root's Path as it stood
+// when cfg's own Path (and those of every other descendant in the same
+// tree) were first computed. It must be passed down explicitly rather than
+// read back off root's current Path, because root may be a clone shared
+// across multiple callers whose own request Paths sit at different depths
+// in the overall configuration.
 //
 // This is used for modules loaded directly from test files. In order to load
 // them properly, and reuse the code for loading modules from normal
@@ -267,12 +620,12 @@ func loadModule(ctx context.Context, root *Config, req *ModuleRequest, walker Mo
 // This function updates cfg so that it treats the provided root as the actual
 // root of this module tree. It then recurses into all the child modules and
 // does the same for them.
-func rebaseChildModule(cfg *Config, root *Config) {
+func rebaseChildModule(cfg *Config, origRootPathLen int, root *Config) {
 	for _, child := range cfg.Children {
-		rebaseChildModule(child, root)
+		rebaseChildModule(child, origRootPathLen, root)
 	}
 
-	cfg.Path = cfg.Path[len(root.Path):]
+	cfg.Path = cfg.Path[origRootPathLen:]
 	cfg.Root = root
 }
 
@@ -288,6 +641,108 @@ type RegistryModuleDeprecation struct {
 	ExternalLink string
 }
 
+// DeprecationReport is a flattened, single-module view of a registry
+// deprecation notice discovered somewhere in a module tree. It's produced by
+// (*Config).CollectDeprecations for consumers that would rather not walk the
+// Children tree and ModuleDeprecationInfo.ExternalDependencies themselves.
+type DeprecationReport struct {
+	// ModulePath is the path, from the root module, to the module call that
+	// the deprecation notice applies to.
+	ModulePath addrs.Module
+
+	// SourceAddr is the source address of the deprecated module, as given in
+	// configuration.
+	SourceAddr addrs.ModuleSource
+
+	// Message is the human-readable deprecation message returned by the
+	// module registry.
+	Message string
+
+	// ExternalLink is an optional URL with further information about the
+	// deprecation, as returned by the module registry.
+	ExternalLink string
+
+	// Subject is the source range a caller should highlight when presenting
+	// this deprecation to a user, such as an editor's squiggly underline.
+	Subject *hcl.Range
+}
+
+// CollectDeprecations walks the module tree rooted at c and returns a flat
+// list of DeprecationReport values, one per registry module deprecation
+// found anywhere in the tree, in depth-first order over the Children map
+// (itself traversed in sorted-name order, for a stable result).
+//
+// This lets callers such as "terraform validate -json" and "terraform init"
+// surface deprecations without needing to understand the internal
+// Children/ModuleDeprecationInfo representation.
+func (c *Config) CollectDeprecations() []DeprecationReport {
+	var reports []DeprecationReport
+	c.collectDeprecations(&reports)
+	return reports
+}
+
+func (c *Config) collectDeprecations(reports *[]DeprecationReport) {
+	if dep := c.Deprecation; dep != nil && dep.RegistryDeprecation != nil {
+		*reports = append(*reports, DeprecationReport{
+			ModulePath:   c.Path,
+			SourceAddr:   c.SourceAddr,
+			Message:      dep.RegistryDeprecation.Message,
+			ExternalLink: dep.RegistryDeprecation.ExternalLink,
+			Subject:      dep.RegistryDeprecation.Subject,
+		})
+	}
+
+	childNames := make([]string, 0, len(c.Children))
+	for name := range c.Children {
+		childNames = append(childNames, name)
+	}
+	sort.Strings(childNames)
+	for _, name := range childNames {
+		c.Children[name].collectDeprecations(reports)
+	}
+}
+
+// deprecationReportJSON is the wire format produced by
+// DeprecationReport.MarshalJSON. It exists separately from DeprecationReport
+// because hcl.Pos already has the json tags we want, but hcl.Range does not,
+// and addrs.Module/addrs.ModuleSource are more useful to JSON consumers in
+// their string form than however they'd marshal by default.
+type deprecationReportJSON struct {
+	ModulePath   string `json:"module_path"`
+	SourceAddr   string `json:"source_addr"`
+	Message      string `json:"message"`
+	ExternalLink string `json:"external_link,omitempty"`
+	Subject      *struct {
+		Filename string  `json:"filename"`
+		Start    hcl.Pos `json:"start"`
+		End      hcl.Pos `json:"end"`
+	} `json:"subject,omitempty"`
+}
+
+// MarshalJSON implements json.Marshaler, producing the machine-readable form
+// of a deprecation notice consumed by "terraform validate -json" and similar
+// tooling.
+func (r DeprecationReport) MarshalJSON() ([]byte, error) {
+	out := deprecationReportJSON{
+		ModulePath:   r.ModulePath.String(),
+		SourceAddr:   r.SourceAddr.String(),
+		Message:      r.Message,
+		ExternalLink: r.ExternalLink,
+	}
+	if r.Subject != nil {
+		out.Subject = &struct {
+			Filename string  `json:"filename"`
+			Start    hcl.Pos `json:"start"`
+			End      hcl.Pos `json:"end"`
+		}{
+			Filename: r.Subject.Filename,
+			Start:    r.Subject.Start,
+			End:      r.Subject.End,
+		}
+	}
+	return json.Marshal(out)
+}
+
 // A ModuleWalker knows how to find and load a child module given details about
 // the module to be loaded and a reference to its partially-loaded parent
 // Config.
@@ -303,6 +758,16 @@ type ModuleWalker interface {
 	// ensure that the basic file- and module-validations performed by the
 	// LoadConfigDir function (valid syntax, no namespace collisions, etc) have
 	// been performed before returning a module.
+	//
+	// Concurrency safety: when BuildConfig is called with a *BuildConfigOptions
+	// whose Concurrency is greater than one, LoadModule may be invoked
+	// concurrently from multiple goroutines, for sibling module calls (or
+	// test runs) and for modules at different levels of the tree alike.
+	// Implementations must be safe
+	// for concurrent use in that case, for example by guarding any shared
+	// cache or registry client state with a mutex. Implementations that are
+	// not safe for concurrent use should simply be used only with the
+	// default sequential behavior (a nil options value, or Concurrency <= 1).
 	LoadModule(ctx context.Context, req *ModuleRequest) (*Module, *version.Version, hcl.Diagnostics, *ModuleDeprecationInfo)
 }
 
@@ -0,0 +1,107 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: BUSL-1.1
+
+package configs
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	version "github.com/hashicorp/go-version"
+	"github.com/hashicorp/hcl/v2"
+
+	"github.com/hashicorp/terraform/internal/addrs"
+)
+
+// TestBuildChildModulesConcurrency covers the bounded-concurrency behavior
+// BuildConfigOptions.Concurrency adds to buildChildModules: sibling module
+// calls may run concurrently, but never more than Concurrency at once, and
+// the results come back merged deterministically by call name regardless of
+// the order in which the concurrent loads actually complete.
+func TestBuildChildModulesConcurrency(t *testing.T) {
+	calls := map[string]*ModuleCall{
+		"a": {Name: "a", SourceAddr: addrs.ModuleSourceLocal("./a")},
+		"b": {Name: "b", SourceAddr: addrs.ModuleSourceLocal("./b")},
+		"c": {Name: "c", SourceAddr: addrs.ModuleSourceLocal("./c")},
+	}
+	parent := &Config{Module: &Module{SourceDir: ".", ModuleCalls: calls}}
+	parent.Root = parent
+
+	var mu sync.Mutex
+	var active, maxActive int32
+	// "c" finishes first and "a" last, the reverse of sorted order, so a
+	// naive implementation that merged results in completion order rather
+	// than sorted call-name order would be caught by the ordering check
+	// below.
+	delays := map[string]time.Duration{"a": 15 * time.Millisecond, "b": 10 * time.Millisecond, "c": 5 * time.Millisecond}
+
+	walker := ModuleWalkerFunc(func(ctx context.Context, req *ModuleRequest) (*Module, *version.Version, hcl.Diagnostics, *ModuleDeprecationInfo) {
+		mu.Lock()
+		active++
+		if active > maxActive {
+			maxActive = active
+		}
+		mu.Unlock()
+
+		time.Sleep(delays[req.Name])
+
+		mu.Lock()
+		active--
+		mu.Unlock()
+
+		return &Module{SourceDir: "child/" + req.Name}, nil, nil, nil
+	})
+
+	children, diags, _ := buildChildModules(context.Background(), parent, walker, &BuildConfigOptions{Concurrency: 2})
+	if diags.HasErrors() {
+		t.Fatalf("unexpected errors: %s", diags)
+	}
+	if maxActive > 2 {
+		t.Fatalf("expected at most 2 concurrent LoadModule calls with Concurrency: 2, saw %d", maxActive)
+	}
+	if len(children) != len(calls) {
+		t.Fatalf("expected %d children, got %d", len(calls), len(children))
+	}
+	for name := range calls {
+		child, ok := children[name]
+		if !ok || child == nil {
+			t.Fatalf("missing child %q in result", name)
+		}
+		if got, want := child.Module.SourceDir, "child/"+name; got != want {
+			t.Fatalf("child %q SourceDir = %q, want %q (results merged out of order)", name, got, want)
+		}
+	}
+}
+
+// TestBuildChildModulesSequentialByDefault covers the documented default:
+// a nil *BuildConfigOptions (and so a nil opts argument to BuildConfig) must
+// still walk every child module, one at a time, with no concurrency.
+func TestBuildChildModulesSequentialByDefault(t *testing.T) {
+	calls := map[string]*ModuleCall{
+		"a": {Name: "a", SourceAddr: addrs.ModuleSourceLocal("./a")},
+		"b": {Name: "b", SourceAddr: addrs.ModuleSourceLocal("./b")},
+	}
+	parent := &Config{Module: &Module{SourceDir: ".", ModuleCalls: calls}}
+	parent.Root = parent
+
+	var active int32
+	walker := ModuleWalkerFunc(func(ctx context.Context, req *ModuleRequest) (*Module, *version.Version, hcl.Diagnostics, *ModuleDeprecationInfo) {
+		if n := atomic.AddInt32(&active, 1); n > 1 {
+			t.Fatalf("expected no concurrent LoadModule calls with nil options, saw %d active", n)
+		}
+		time.Sleep(time.Millisecond)
+		atomic.AddInt32(&active, -1)
+		return &Module{SourceDir: "child/" + req.Name}, nil, nil, nil
+	})
+
+	children, diags, _ := buildChildModules(context.Background(), parent, walker, nil)
+	if diags.HasErrors() {
+		t.Fatalf("unexpected errors: %s", diags)
+	}
+	if len(children) != len(calls) {
+		t.Fatalf("expected %d children, got %d", len(calls), len(children))
+	}
+}
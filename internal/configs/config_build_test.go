@@ -0,0 +1,159 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: BUSL-1.1
+
+package configs
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync/atomic"
+	"testing"
+
+	version "github.com/hashicorp/go-version"
+	"github.com/hashicorp/hcl/v2"
+
+	"github.com/hashicorp/terraform/internal/addrs"
+)
+
+// countingModuleWalker is a ModuleWalker that records how many times
+// LoadModule was actually invoked for the fixture module, so tests and
+// benchmarks can assert that buildTestModules' cache collapsed many run
+// blocks sharing a fixture module down to a single real load.
+type countingModuleWalker struct {
+	loads int32
+}
+
+func (w *countingModuleWalker) LoadModule(ctx context.Context, req *ModuleRequest) (*Module, *version.Version, hcl.Diagnostics, *ModuleDeprecationInfo) {
+	if req.Name == "child" {
+		// The fixture's nested child is a plain leaf module, loaded as part
+		// of each real fixture load, and isn't counted.
+		return &Module{SourceDir: "testdata/fixture/child"}, nil, nil, nil
+	}
+	atomic.AddInt32(&w.loads, 1)
+	return &Module{
+		SourceDir: "testdata/fixture",
+		ModuleCalls: map[string]*ModuleCall{
+			"child": {Name: "child", SourceAddr: addrs.ModuleSourceLocal("./child")},
+		},
+		Import: []*ImportBlock{
+			{DeclRange: hcl.Range{Filename: "fixture.tf"}},
+		},
+	}, nil, nil, nil
+}
+
+// buildSharedFixtureTestFile builds a synthetic TestFile with n run blocks
+// that all reference the same fixture module, the way a large test suite
+// commonly reuses one setup module across many run blocks.
+func buildSharedFixtureTestFile(n int) *TestFile {
+	file := &TestFile{}
+	for i := 0; i < n; i++ {
+		file.Runs = append(file.Runs, &TestRun{
+			Name: fmt.Sprintf("run_%d", i),
+			Module: &TestRunModuleCall{
+				Source: addrs.ModuleSourceLocal("./fixture"),
+			},
+		})
+	}
+	return file
+}
+
+// BenchmarkBuildTestModulesSharedModule demonstrates that buildTestModules
+// loads a fixture module shared by many run blocks only once, rather than
+// once per run block, by asserting the walker only sees a single LoadModule
+// call across 50 identical run blocks.
+func BenchmarkBuildTestModulesSharedModule(b *testing.B) {
+	root := &Config{
+		Module: &Module{
+			SourceDir: ".",
+			Tests: map[string]*TestFile{
+				"main.tftest.hcl": buildSharedFixtureTestFile(50),
+			},
+		},
+	}
+	root.Root = root
+
+	opts := &BuildConfigOptions{Concurrency: 8}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		walker := &countingModuleWalker{}
+		buildTestModules(context.Background(), root, walker, opts)
+		if walker.loads != 1 {
+			b.Fatalf("expected 1 load for 50 runs sharing a fixture module, got %d", walker.loads)
+		}
+	}
+}
+
+// TestBuildTestModulesSharedModuleCache is the real (non-benchmark) test
+// covering the same cache behavior BenchmarkBuildTestModulesSharedModule
+// exercises for timing, plus the two bugs fixed alongside it: a shared
+// cache entry's descendants must be rebased relative to their own original
+// root even when the runs sharing that entry live at different test-file
+// depths, and each run's import-block diagnostic must be regenerated
+// against its own path rather than replayed from whichever run first
+// populated the cache.
+func TestBuildTestModulesSharedModuleCache(t *testing.T) {
+	root := &Config{
+		Module: &Module{
+			SourceDir: ".",
+			Tests: map[string]*TestFile{
+				// Two runs at different path depths (3 vs 5 path
+				// elements once resolved in buildTestModules) that
+				// both reference the same fixture module, so they
+				// share one cache entry.
+				"main.tftest.hcl": {
+					Runs: []*TestRun{
+						{Name: "setup", Module: &TestRunModuleCall{Source: addrs.ModuleSourceLocal("./fixture")}},
+					},
+				},
+				"tests/sub/main.tftest.hcl": {
+					Runs: []*TestRun{
+						{Name: "setup", Module: &TestRunModuleCall{Source: addrs.ModuleSourceLocal("./fixture")}},
+					},
+				},
+			},
+		},
+	}
+	root.Root = root
+
+	walker := &countingModuleWalker{}
+	diags := buildTestModules(context.Background(), root, walker, &BuildConfigOptions{Concurrency: 2})
+
+	if walker.loads != 1 {
+		t.Fatalf("expected the shared fixture module to be loaded once, got %d loads", walker.loads)
+	}
+
+	runA := root.Module.Tests["main.tftest.hcl"].Runs[0]
+	runB := root.Module.Tests["tests/sub/main.tftest.hcl"].Runs[0]
+
+	if runA.ConfigUnderTest == nil || runB.ConfigUnderTest == nil {
+		t.Fatalf("expected both runs to get a ConfigUnderTest")
+	}
+	if len(runA.ConfigUnderTest.Path) != 0 || len(runB.ConfigUnderTest.Path) != 0 {
+		t.Fatalf("expected each run's own ConfigUnderTest.Path to be empty, got %v and %v", runA.ConfigUnderTest.Path, runB.ConfigUnderTest.Path)
+	}
+
+	wantChildPath := addrs.Module{"child"}
+	childA := runA.ConfigUnderTest.Children["child"]
+	childB := runB.ConfigUnderTest.Children["child"]
+	if childA == nil || childB == nil {
+		t.Fatalf("expected both runs' ConfigUnderTest to carry the nested child module")
+	}
+	if !reflect.DeepEqual(childA.Path, wantChildPath) {
+		t.Errorf("runA child path = %v, want %v (despite runA/runB living at different test-file depths)", childA.Path, wantChildPath)
+	}
+	if !reflect.DeepEqual(childB.Path, wantChildPath) {
+		t.Errorf("runB child path = %v, want %v (despite runA/runB living at different test-file depths)", childB.Path, wantChildPath)
+	}
+
+	var importDiagCount int
+	for _, d := range diags {
+		if d.Summary == "Invalid import configuration" {
+			importDiagCount++
+		}
+	}
+	if importDiagCount != 2 {
+		t.Fatalf("expected one import-block diagnostic per run sharing the cache entry (2 total), got %d", importDiagCount)
+	}
+}
@@ -0,0 +1,135 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: BUSL-1.1
+
+package configs
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/hashicorp/hcl/v2"
+
+	"github.com/hashicorp/terraform/internal/addrs"
+)
+
+// TestConfigCollectDeprecations covers flattening a module tree's
+// deprecation notices: only modules that actually carry a registry
+// deprecation should produce a report, and the traversal must visit every
+// child regardless of nesting.
+func TestConfigCollectDeprecations(t *testing.T) {
+	subject := &hcl.Range{Filename: "main.tf"}
+
+	root := &Config{
+		Path: addrs.Module{},
+		Children: map[string]*Config{
+			"clean": {
+				Path: addrs.Module{"clean"},
+			},
+			"deprecated": {
+				Path:       addrs.Module{"deprecated"},
+				SourceAddr: addrs.ModuleSourceRegistry{},
+				Deprecation: &ModuleDeprecationInfo{
+					SourceName: "deprecated",
+					RegistryDeprecation: &RegistryModuleDeprecation{
+						Message:      "use the new module instead",
+						ExternalLink: "https://example.com/migrate",
+						Subject:      subject,
+					},
+				},
+				Children: map[string]*Config{
+					"nested": {
+						Path:       addrs.Module{"deprecated", "nested"},
+						SourceAddr: addrs.ModuleSourceRegistry{},
+						Deprecation: &ModuleDeprecationInfo{
+							SourceName: "nested",
+							RegistryDeprecation: &RegistryModuleDeprecation{
+								Message: "this one too",
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	reports := root.CollectDeprecations()
+	if len(reports) != 2 {
+		t.Fatalf("expected 2 deprecation reports, got %d: %#v", len(reports), reports)
+	}
+
+	byPath := make(map[string]DeprecationReport, len(reports))
+	for _, r := range reports {
+		byPath[r.ModulePath.String()] = r
+	}
+
+	top, ok := byPath[addrs.Module{"deprecated"}.String()]
+	if !ok {
+		t.Fatalf("missing report for the top-level deprecated module: %#v", reports)
+	}
+	if top.Message != "use the new module instead" {
+		t.Errorf("top-level message = %q, want %q", top.Message, "use the new module instead")
+	}
+	if top.Subject != subject {
+		t.Errorf("top-level Subject not carried through from RegistryModuleDeprecation")
+	}
+
+	if _, ok := byPath[addrs.Module{"deprecated", "nested"}.String()]; !ok {
+		t.Fatalf("missing report for the nested deprecated module: %#v", reports)
+	}
+}
+
+// TestDeprecationReportMarshalJSON covers the wire format produced for
+// "terraform validate -json" and similar tooling, including that a nil
+// Subject is omitted rather than marshaled as a zero-valued object.
+func TestDeprecationReportMarshalJSON(t *testing.T) {
+	report := DeprecationReport{
+		ModulePath:   addrs.Module{"deprecated"},
+		SourceAddr:   addrs.ModuleSourceRegistry{},
+		Message:      "use the new module instead",
+		ExternalLink: "https://example.com/migrate",
+		Subject: &hcl.Range{
+			Filename: "main.tf",
+			Start:    hcl.Pos{Line: 1, Column: 1},
+			End:      hcl.Pos{Line: 1, Column: 10},
+		},
+	}
+
+	data, err := json.Marshal(report)
+	if err != nil {
+		t.Fatalf("MarshalJSON failed: %s", err)
+	}
+
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("decoding marshaled report: %s", err)
+	}
+	if decoded["message"] != report.Message {
+		t.Errorf("message = %v, want %q", decoded["message"], report.Message)
+	}
+	if decoded["module_path"] != report.ModulePath.String() {
+		t.Errorf("module_path = %v, want %q", decoded["module_path"], report.ModulePath.String())
+	}
+	subject, ok := decoded["subject"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("expected a subject object in marshaled output, got %#v", decoded["subject"])
+	}
+	if subject["filename"] != "main.tf" {
+		t.Errorf("subject.filename = %v, want %q", subject["filename"], "main.tf")
+	}
+
+	noSubject := DeprecationReport{
+		ModulePath: addrs.Module{"deprecated"},
+		SourceAddr: addrs.ModuleSourceRegistry{},
+		Message:    "use the new module instead",
+	}
+	data, err = json.Marshal(noSubject)
+	if err != nil {
+		t.Fatalf("MarshalJSON failed: %s", err)
+	}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("decoding marshaled report: %s", err)
+	}
+	if _, ok := decoded["subject"]; ok {
+		t.Errorf("expected subject to be omitted when nil, got %#v", decoded["subject"])
+	}
+}
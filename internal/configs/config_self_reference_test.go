@@ -0,0 +1,200 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: BUSL-1.1
+
+package configs
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	version "github.com/hashicorp/go-version"
+	"github.com/hashicorp/hcl/v2"
+
+	"github.com/hashicorp/terraform/internal/addrs"
+)
+
+// TestLoadModuleSelfReferenceLocalCycle covers the case the self-reference
+// check exists for: a local module, several levels deep, that calls back up
+// into one of its own ancestors via a relative path like "../..". Detecting
+// this requires resolving local source addresses against the calling
+// module's directory rather than comparing the as-written relative path
+// strings, since "../.." only means the same thing as an ancestor's
+// directory once it's actually resolved.
+func TestLoadModuleSelfReferenceLocalCycle(t *testing.T) {
+	ctx := context.Background()
+
+	root := &Config{Module: &Module{SourceDir: "/work/root"}}
+	root.Root = root
+	root.canonicalSourceKey = "dir:" + root.Module.SourceDir
+
+	cfgA, diags, _ := loadModule(ctx, root, &ModuleRequest{
+		Name:       "a",
+		Path:       addrs.Module{"a"},
+		SourceAddr: addrs.ModuleSourceLocal("./a"),
+		Parent:     root,
+	}, ModuleWalkerFunc(func(ctx context.Context, req *ModuleRequest) (*Module, *version.Version, hcl.Diagnostics, *ModuleDeprecationInfo) {
+		return &Module{SourceDir: "/work/root/a"}, nil, nil, nil
+	}), nil)
+	if diags.HasErrors() {
+		t.Fatalf("unexpected errors loading module a: %s", diags)
+	}
+
+	cfgB, diags, _ := loadModule(ctx, root, &ModuleRequest{
+		Name:       "b",
+		Path:       addrs.Module{"a", "b"},
+		SourceAddr: addrs.ModuleSourceLocal("./b"),
+		Parent:     cfgA,
+	}, ModuleWalkerFunc(func(ctx context.Context, req *ModuleRequest) (*Module, *version.Version, hcl.Diagnostics, *ModuleDeprecationInfo) {
+		return &Module{SourceDir: "/work/root/a/b"}, nil, nil, nil
+	}), nil)
+	if diags.HasErrors() {
+		t.Fatalf("unexpected errors loading module b: %s", diags)
+	}
+
+	loopCfg, diags, _ := loadModule(ctx, root, &ModuleRequest{
+		Name:       "loopback",
+		Path:       addrs.Module{"a", "b", "loopback"},
+		SourceAddr: addrs.ModuleSourceLocal("../.."),
+		Parent:     cfgB,
+	}, ModuleWalkerFunc(func(ctx context.Context, req *ModuleRequest) (*Module, *version.Version, hcl.Diagnostics, *ModuleDeprecationInfo) {
+		return &Module{SourceDir: "/work/root"}, nil, nil, nil
+	}), nil)
+
+	if loopCfg != nil {
+		t.Fatalf("expected nil Config for a detected self-reference, got %#v", loopCfg)
+	}
+	if !diags.HasErrors() {
+		t.Fatalf("expected a self-reference error, got none")
+	}
+
+	var found bool
+	for _, d := range diags {
+		if d.Summary != "Module self-reference detected" {
+			continue
+		}
+		found = true
+		if want := "./a -> ./b -> ../.."; !strings.Contains(d.Detail, want) {
+			t.Errorf("diagnostic detail = %q, want it to contain %q", d.Detail, want)
+		}
+		if n := strings.Count(d.Detail, "../.."); n != 1 {
+			t.Errorf("diagnostic detail repeats the closing address %d times, want 1: %q", n, d.Detail)
+		}
+	}
+	if !found {
+		t.Fatalf("expected a %q diagnostic, got: %s", "Module self-reference detected", diags)
+	}
+}
+
+// TestLoadModuleSelfReferenceUnrelatedSameRelativePath covers the opposite
+// failure mode: two unrelated modules at different depths that happen to
+// both write the same relative path (e.g. each vendoring a shared helper at
+// "./modules/common") must NOT be flagged as a self-reference, since that
+// relative path resolves to two different real directories.
+func TestLoadModuleSelfReferenceUnrelatedSameRelativePath(t *testing.T) {
+	ctx := context.Background()
+
+	root := &Config{Module: &Module{SourceDir: "/work/root"}}
+	root.Root = root
+	root.canonicalSourceKey = "dir:" + root.Module.SourceDir
+
+	cfgA, diags, _ := loadModule(ctx, root, &ModuleRequest{
+		Name:       "a",
+		Path:       addrs.Module{"a"},
+		SourceAddr: addrs.ModuleSourceLocal("./modules/common"),
+		Parent:     root,
+	}, ModuleWalkerFunc(func(ctx context.Context, req *ModuleRequest) (*Module, *version.Version, hcl.Diagnostics, *ModuleDeprecationInfo) {
+		return &Module{SourceDir: "/work/root/modules/common"}, nil, nil, nil
+	}), nil)
+	if diags.HasErrors() {
+		t.Fatalf("unexpected errors loading module a: %s", diags)
+	}
+
+	// "a" and its own child "common" both write the same relative path,
+	// but those paths resolve under different directories, so this must
+	// not be treated as "common" calling back into "a".
+	commonCfg, diags, _ := loadModule(ctx, root, &ModuleRequest{
+		Name:       "common",
+		Path:       addrs.Module{"a", "common"},
+		SourceAddr: addrs.ModuleSourceLocal("./modules/common"),
+		Parent:     cfgA,
+	}, ModuleWalkerFunc(func(ctx context.Context, req *ModuleRequest) (*Module, *version.Version, hcl.Diagnostics, *ModuleDeprecationInfo) {
+		return &Module{SourceDir: "/work/root/modules/common/modules/common"}, nil, nil, nil
+	}), nil)
+	if diags.HasErrors() {
+		t.Fatalf("expected no self-reference error, got: %s", diags)
+	}
+	if commonCfg == nil {
+		t.Fatalf("expected a Config for the unrelated module, got nil")
+	}
+}
+
+// TestLoadModuleVersionedCycleAllowed covers AllowVersionedModuleCycles: a
+// registry module is allowed to appear again among its own ancestors as
+// long as the two occurrences resolve to different versions, but the same
+// setup must still be rejected when that option isn't set.
+func TestLoadModuleVersionedCycleAllowed(t *testing.T) {
+	ctx := context.Background()
+
+	v1, err := version.NewVersion("1.0.0")
+	if err != nil {
+		t.Fatalf("parsing version: %s", err)
+	}
+	v2, err := version.NewVersion("2.0.0")
+	if err != nil {
+		t.Fatalf("parsing version: %s", err)
+	}
+
+	// A zero-value registry source is shared between the ancestor and the
+	// candidate below; only the resolved version differs, which is what
+	// should make this an allowed versioned cycle rather than a plain
+	// self-reference error.
+	regAddr := addrs.ModuleSourceRegistry{}
+
+	root := &Config{Module: &Module{SourceDir: "/work/root"}}
+	root.Root = root
+	root.canonicalSourceKey = "dir:" + root.Module.SourceDir
+
+	ancestor, diags, _ := loadModule(ctx, root, &ModuleRequest{
+		Name:       "b",
+		Path:       addrs.Module{"b"},
+		SourceAddr: regAddr,
+		Parent:     root,
+	}, ModuleWalkerFunc(func(ctx context.Context, req *ModuleRequest) (*Module, *version.Version, hcl.Diagnostics, *ModuleDeprecationInfo) {
+		return &Module{SourceDir: "/registry-cache/b@1.0.0"}, v1, nil, nil
+	}), nil)
+	if diags.HasErrors() {
+		t.Fatalf("unexpected errors loading ancestor module: %s", diags)
+	}
+
+	allowWalker := ModuleWalkerFunc(func(ctx context.Context, req *ModuleRequest) (*Module, *version.Version, hcl.Diagnostics, *ModuleDeprecationInfo) {
+		return &Module{SourceDir: "/registry-cache/b@2.0.0"}, v2, nil, nil
+	})
+
+	cfg, diags, _ := loadModule(ctx, root, &ModuleRequest{
+		Name:       "b2",
+		Path:       addrs.Module{"b", "b2"},
+		SourceAddr: regAddr,
+		Parent:     ancestor,
+	}, allowWalker, &BuildConfigOptions{AllowVersionedModuleCycles: true})
+	if diags.HasErrors() {
+		t.Fatalf("expected the versioned cycle to be allowed, got: %s", diags)
+	}
+	if cfg == nil {
+		t.Fatalf("expected a Config for the allowed versioned cycle, got nil")
+	}
+
+	// Without the opt-in, the identical setup must still be rejected.
+	cfg, diags, _ = loadModule(ctx, root, &ModuleRequest{
+		Name:       "b3",
+		Path:       addrs.Module{"b", "b3"},
+		SourceAddr: regAddr,
+		Parent:     ancestor,
+	}, allowWalker, nil)
+	if cfg != nil {
+		t.Fatalf("expected nil Config without AllowVersionedModuleCycles, got %#v", cfg)
+	}
+	if !diags.HasErrors() {
+		t.Fatalf("expected a self-reference error without AllowVersionedModuleCycles")
+	}
+}